@@ -1,14 +1,10 @@
 package aws
 
 import (
-	"errors"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/docker/libmachete"
@@ -26,23 +22,30 @@ type Builder struct {
 func (a Builder) Build(params map[string]string) (api.Provisioner, error) {
 	region := params["REGION"]
 	if region == "" {
-		return nil, errors.New("REGION must be specified")
+		discovered, err := regionFromInstanceMetadata()
+		if err != nil {
+			return nil, fmt.Errorf("REGION not specified and could not be discovered from instance metadata: %s", err)
+		}
+		region = discovered
 	}
 
 	accessKey := params["ACCESS_KEY"]
 	secretKey := params["SECRET_KEY"]
 	sessionToken := params["SESSION_TOKEN"]
 
-	awsCredentials := credentials.NewChainCredentials([]credentials.Provider{
-		&credentials.StaticProvider{Value: credentials.Value{
-			AccessKeyID:     accessKey,
-			SecretAccessKey: secretKey,
-			SessionToken:    sessionToken,
-		}},
-		&credentials.EnvProvider{},
-		&credentials.SharedCredentialsProvider{},
-		&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
-	})
+	awsCredentials := newCredentialChain(&credentials.StaticProvider{Value: credentials.Value{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    sessionToken,
+	}})
+
+	if roleARN := params["ROLE_ARN"]; roleARN != "" {
+		// params is a flat map[string]string, so there's no way for a caller
+		// to supply an MFA token-provider callback here; nil falls back to
+		// prompting on stdin, which is fine for this one-off CLI entry point.
+		awsCredentials = assumeRoleCredentials(
+			region, awsCredentials, roleARN, params["ROLE_SESSION_NAME"], params["EXTERNAL_ID"], params["MFA_SERIAL"], nil)
+	}
 
 	client := CreateClient(region, awsCredentials, 5)
 
@@ -53,8 +56,15 @@ func (a Builder) Build(params map[string]string) (api.Provisioner, error) {
 func ProvisionerWith(ctx context.Context, cred api.Credential) (api.Provisioner, error) {
 
 	region, ok := RegionFromContext(ctx)
-	if !ok {
-		return nil, fmt.Errorf("No region in context")
+	resolvedRegion := ""
+	if ok {
+		resolvedRegion = *region
+	} else {
+		discovered, err := regionFromInstanceMetadata()
+		if err != nil {
+			return nil, fmt.Errorf("no region in context and could not discover one from instance metadata: %s", err)
+		}
+		resolvedRegion = discovered
 	}
 
 	retries := 5
@@ -67,12 +77,14 @@ func ProvisionerWith(ctx context.Context, cred api.Credential) (api.Provisioner,
 		return nil, err
 	}
 
-	client := CreateClient(*region, credentials.NewChainCredentials([]credentials.Provider{
-		&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
-		&credentials.EnvProvider{},
-		&credentials.SharedCredentialsProvider{},
-		c,
-	}), retries)
+	awsCredentials := newCredentialChain(c)
+
+	if cred.RoleARN != "" {
+		awsCredentials = assumeRoleCredentials(
+			resolvedRegion, awsCredentials, cred.RoleARN, cred.RoleSessionName, cred.ExternalID, cred.MFASerial, cred.MFATokenProvider)
+	}
+
+	client := CreateClient(resolvedRegion, awsCredentials, retries)
 
 	return New(client), nil
 }
@@ -87,14 +99,12 @@ func New(client ec2iface.EC2API) api.Provisioner {
 	return &provisioner{client: client, sleepFunction: time.Sleep}
 }
 
-// CreateClient creates the actual EC2 API client.
+// CreateClient creates the actual EC2 API client, wrapped with adaptive
+// throttle handling so that transient EC2 rate limiting doesn't surface as
+// errors to callers.
 func CreateClient(region string, awsCredentials *credentials.Credentials, retryCount int) ec2iface.EC2API {
-	return ec2.New(session.New(aws.NewConfig().
-		WithRegion(region).
-		WithCredentials(awsCredentials).
-		WithLogger(getLogger()).
-		WithLogLevel(aws.LogDebugWithHTTPBody).
-		WithMaxRetries(retryCount)))
+	client := ec2.New(newAWSSession(region, awsCredentials, retryCount))
+	return newThrottledClient(client, time.Sleep)
 }
 
 func getInstanceSync(client ec2iface.EC2API, instanceID string) (*ec2.Instance, error) {
@@ -110,7 +120,7 @@ func getInstanceSync(client ec2iface.EC2API, instanceID string) (*ec2.Instance,
 	return result.Reservations[0].Instances[0], nil
 }
 
-func tagSync(client ec2iface.EC2API, request CreateInstanceRequest, instance *ec2.Instance) error {
+func buildTags(request CreateInstanceRequest) []*ec2.Tag {
 	tags := []*ec2.Tag{}
 
 	// Gather the tag keys in sorted order, to provide predictable tag order.  This is
@@ -130,9 +140,13 @@ func tagSync(client ec2iface.EC2API, request CreateInstanceRequest, instance *ec
 		})
 	}
 
+	return tags
+}
+
+func tagSync(client ec2iface.EC2API, request CreateInstanceRequest, instance *ec2.Instance) error {
 	_, err := client.CreateTags(&ec2.CreateTagsInput{
 		Resources: []*string{instance.InstanceId},
-		Tags:      tags,
+		Tags:      buildTags(request),
 	})
 	return err
 }
@@ -257,7 +271,13 @@ func (p *provisioner) CreateInstance(
 
 		events <- api.CreateInstanceEvent{Type: api.CreateInstanceStarted}
 
-		instance, err := createInstanceSync(p.client, *request)
+		var instance *ec2.Instance
+		var err error
+		if request.SpotPrice != "" {
+			instance, err = p.createSpotInstance(*request, events)
+		} else {
+			instance, err = createInstanceSync(p.client, *request)
+		}
 		if err != nil {
 			events <- api.CreateInstanceEvent{
 				Error: err,
@@ -316,6 +336,14 @@ func (p *provisioner) DestroyInstance(instanceID string) (<-chan api.DestroyInst
 
 		events <- api.DestroyInstanceEvent{Type: api.DestroyInstanceStarted}
 
+		// Best-effort: a persistent spot request left behind would otherwise
+		// relaunch a new instance after this one is terminated, but failing
+		// to look it up (e.g. a transient describe error) shouldn't block the
+		// termination the caller actually asked for.
+		if err := cancelPersistentSpotRequest(p.client, instanceID); err != nil {
+			log.Warnln("failed to cancel persistent spot request for", instanceID, ":", err)
+		}
+
 		err := destroyInstanceSync(p.client, instanceID)
 		if err != nil {
 			events <- api.DestroyInstanceEvent{
@@ -0,0 +1,133 @@
+package aws
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+func createInstancesSync(
+	client ec2iface.EC2API,
+	request CreateInstanceRequest,
+	count int) ([]*ec2.Instance, error) {
+
+	reservation, err := client.RunInstances(&ec2.RunInstancesInput{
+		ImageId:  &request.ImageID,
+		MinCount: aws.Int64(1),
+		MaxCount: aws.Int64(int64(count)),
+		Placement: &ec2.Placement{
+			AvailabilityZone: &request.AvailabilityZone,
+		},
+		KeyName:      &request.KeyName,
+		InstanceType: &request.InstanceType,
+		NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{
+			DeviceIndex:              aws.Int64(0), // eth0
+			Groups:                   makePointerSlice(request.SecurityGroupIds),
+			SubnetId:                 &request.SubnetID,
+			AssociatePublicIpAddress: &request.AssociatePublicIPAddress,
+			DeleteOnTermination:      &request.DeleteOnTermination,
+		}},
+		Monitoring: &ec2.RunInstancesMonitoringEnabled{
+			Enabled: &request.Monitoring,
+		},
+		IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
+			Name: &request.IamInstanceProfile,
+		},
+		EbsOptimized: &request.EbsOptimized,
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{
+				DeviceName: &request.BlockDeviceName,
+				Ebs: &ec2.EbsBlockDevice{
+					VolumeSize:          &request.RootSize,
+					VolumeType:          &request.VolumeType,
+					DeleteOnTermination: &request.DeleteOnTermination,
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reservation == nil || len(reservation.Instances) == 0 {
+		return nil, &ErrUnexpectedResponse{}
+	}
+	return reservation.Instances, nil
+}
+
+func tagInstancesSync(client ec2iface.EC2API, request CreateInstanceRequest, instances []*ec2.Instance) error {
+	resources := make([]*string, len(instances))
+	for i, instance := range instances {
+		resources[i] = instance.InstanceId
+	}
+
+	_, err := client.CreateTags(&ec2.CreateTagsInput{
+		Resources: resources,
+		Tags:      buildTags(request),
+	})
+	return err
+}
+
+// CreateInstances provisions count identical instances with a single
+// RunInstances call, tags them all in one CreateTags call, and then fans
+// out a blockUntilInstanceInState wait per instance, emitting one
+// CreateInstanceEvent per instance as it comes up. If EC2 only partially
+// fulfills the request, the shortfall is reported as a
+// CreateInstanceShortfall event rather than an error, so the caller can
+// decide whether to retry for the rest.
+func (p *provisioner) CreateInstances(req api.MachineRequest, count int) (<-chan api.CreateInstanceEvent, error) {
+	request, is := req.(*CreateInstanceRequest)
+	if !is {
+		return nil, &ErrInvalidRequest{}
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	events := make(chan api.CreateInstanceEvent)
+	go func() {
+		defer close(events)
+
+		events <- api.CreateInstanceEvent{Type: api.CreateInstanceStarted}
+
+		instances, err := createInstancesSync(p.client, *request, count)
+		if err != nil {
+			events <- api.CreateInstanceEvent{Error: err, Type: api.CreateInstanceError}
+			return
+		}
+
+		if len(instances) < count {
+			events <- api.CreateInstanceEvent{
+				Type:      api.CreateInstanceShortfall,
+				Shortfall: count - len(instances),
+			}
+		}
+
+		if err := tagInstancesSync(p.client, *request, instances); err != nil {
+			events <- api.CreateInstanceEvent{Error: err, Type: api.CreateInstanceError}
+			return
+		}
+
+		var wait sync.WaitGroup
+		for _, instance := range instances {
+			wait.Add(1)
+			go func(instanceID string) {
+				defer wait.Done()
+
+				if err := p.blockUntilInstanceInState(instanceID, ec2.InstanceStateNameRunning); err != nil {
+					events <- api.CreateInstanceEvent{Error: err, Type: api.CreateInstanceError, InstanceID: instanceID}
+					return
+				}
+				events <- api.CreateInstanceEvent{Type: api.CreateInstanceCompleted, InstanceID: instanceID}
+			}(*instance.InstanceId)
+		}
+		wait.Wait()
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// newCredentialChain builds the standard infrakit credential chain, trying
+// first in order: ECS task-role endpoint creds (when running inside an ECS
+// task), the environment, the shared credentials file, and finally the EC2
+// instance role. first is tried ahead of all of these, and is typically a
+// caller-supplied static credential.
+func newCredentialChain(first credentials.Provider) *credentials.Credentials {
+	providers := []credentials.Provider{first}
+
+	if ecs := ecsEndpointProvider(); ecs != nil {
+		providers = append(providers, ecs)
+	}
+
+	providers = append(providers,
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+		&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
+	)
+
+	return credentials.NewChainCredentials(providers)
+}
+
+// ecsEndpointProvider returns a credential provider that fetches the ECS
+// task role from the container credentials endpoint, or nil if infrakit
+// isn't running inside an ECS task with one configured.
+func ecsEndpointProvider() credentials.Provider {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "http://169.254.170.2" + endpoint
+	}
+
+	sess := session.New()
+	return endpointcreds.NewProviderClient(*sess.Config, sess.Handlers, endpoint)
+}
+
+// assumeRoleCredentials wraps base so that it is used to assume roleARN via
+// STS, optionally scoped with an external ID and/or an MFA device.
+// Credentials are automatically refreshed and re-assumed as they expire.
+// When mfaSerial is set, mfaTokenProvider supplies the current MFA token;
+// if it's nil, stscreds.StdinTokenProvider is used, which is only suitable
+// for one-off CLI invocations, not for infrakit running as a daemon.
+func assumeRoleCredentials(
+	region string,
+	base *credentials.Credentials,
+	roleARN, sessionName, externalID, mfaSerial string,
+	mfaTokenProvider func() (string, error)) *credentials.Credentials {
+
+	sess := session.New(aws.NewConfig().WithRegion(region).WithCredentials(base))
+
+	return stscreds.NewCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		if sessionName != "" {
+			p.RoleSessionName = sessionName
+		}
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+		if mfaSerial != "" {
+			p.SerialNumber = aws.String(mfaSerial)
+			if mfaTokenProvider != nil {
+				p.TokenProvider = mfaTokenProvider
+			} else {
+				p.TokenProvider = stscreds.StdinTokenProvider
+			}
+		}
+	})
+}
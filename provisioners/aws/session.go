@@ -0,0 +1,62 @@
+package aws
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// newAWSSession builds the session shared by CreateClient and
+// NewSessionFromEnvironment: a region, a credential chain, and the same
+// retry/logger configuration used for the EC2 client.
+func newAWSSession(region string, awsCredentials *credentials.Credentials, retryCount int) *session.Session {
+	return session.New(aws.NewConfig().
+		WithRegion(region).
+		WithCredentials(awsCredentials).
+		WithLogger(getLogger()).
+		WithLogLevel(aws.LogDebugWithHTTPBody).
+		WithMaxRetries(retryCount))
+}
+
+// regionFromInstanceMetadata discovers the region infrakit itself is
+// running in, for when REGION isn't supplied and infrakit is running on
+// an EC2 instance with a reachable IMDS.
+func regionFromInstanceMetadata() (string, error) {
+	return ec2metadata.New(session.New()).Region()
+}
+
+// NewSessionFromEnvironment returns a fully configured AWS session --
+// region, credential chain (including AssumeRole/MFA/ECS task-role
+// support), and retry/logger config -- built the same way the EC2
+// provisioner builds its own client. Other subsystems that need to talk
+// to AWS can use this instead of rebuilding the credential chain
+// themselves.
+func NewSessionFromEnvironment() (*session.Session, error) {
+	region := os.Getenv("REGION")
+	if region == "" {
+		discovered, err := regionFromInstanceMetadata()
+		if err != nil {
+			return nil, fmt.Errorf("REGION not set and could not be discovered from instance metadata: %s", err)
+		}
+		region = discovered
+	}
+
+	awsCredentials := newCredentialChain(&credentials.StaticProvider{Value: credentials.Value{
+		AccessKeyID:     os.Getenv("ACCESS_KEY"),
+		SecretAccessKey: os.Getenv("SECRET_KEY"),
+		SessionToken:    os.Getenv("SESSION_TOKEN"),
+	}})
+
+	if roleARN := os.Getenv("ROLE_ARN"); roleARN != "" {
+		// Same as Builder.Build: environment variables can't carry a token
+		// callback, so MFA-protected roles fall back to prompting on stdin.
+		awsCredentials = assumeRoleCredentials(
+			region, awsCredentials, roleARN, os.Getenv("ROLE_SESSION_NAME"), os.Getenv("EXTERNAL_ID"), os.Getenv("MFA_SERIAL"), nil)
+	}
+
+	return newAWSSession(region, awsCredentials, 5), nil
+}
@@ -0,0 +1,205 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+// Spot instance request status codes that mean the request will never be
+// fulfilled on its own and should be treated as an immediate failure
+// rather than waited out.
+const (
+	spotStatusPriceTooLow          = "price-too-low"
+	spotStatusCapacityNotAvailable = "capacity-not-available"
+)
+
+// ErrSpotRequestFailed indicates a spot instance request did not reach the
+// active state -- for example because the bid in SpotPrice was too low, or
+// there was no spot capacity available for the instance type / AZ.
+type ErrSpotRequestFailed struct {
+	StatusCode string
+	Message    string
+}
+
+func (e *ErrSpotRequestFailed) Error() string {
+	return fmt.Sprintf("spot request failed (%s): %s", e.StatusCode, e.Message)
+}
+
+func requestSpotInstanceSync(client ec2iface.EC2API, request CreateInstanceRequest) (*ec2.SpotInstanceRequest, error) {
+	input := &ec2.RequestSpotInstancesInput{
+		SpotPrice: &request.SpotPrice,
+		LaunchSpecification: &ec2.RequestSpotLaunchSpecification{
+			ImageId: &request.ImageID,
+			Placement: &ec2.SpotPlacement{
+				AvailabilityZone: &request.AvailabilityZone,
+			},
+			KeyName:      &request.KeyName,
+			InstanceType: &request.InstanceType,
+			NetworkInterfaces: []*ec2.InstanceNetworkInterfaceSpecification{{
+				DeviceIndex:              aws.Int64(0), // eth0
+				Groups:                   makePointerSlice(request.SecurityGroupIds),
+				SubnetId:                 &request.SubnetID,
+				AssociatePublicIpAddress: &request.AssociatePublicIPAddress,
+				DeleteOnTermination:      &request.DeleteOnTermination,
+			}},
+			Monitoring: &ec2.RunInstancesMonitoringEnabled{
+				Enabled: &request.Monitoring,
+			},
+			IamInstanceProfile: &ec2.IamInstanceProfileSpecification{
+				Name: &request.IamInstanceProfile,
+			},
+			EbsOptimized: &request.EbsOptimized,
+			BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+				{
+					DeviceName: &request.BlockDeviceName,
+					Ebs: &ec2.EbsBlockDevice{
+						VolumeSize:          &request.RootSize,
+						VolumeType:          &request.VolumeType,
+						DeleteOnTermination: &request.DeleteOnTermination,
+					},
+				},
+			},
+		},
+	}
+
+	if request.SpotInstanceType != "" {
+		input.Type = &request.SpotInstanceType
+	}
+	if request.BlockDurationMinutes > 0 {
+		input.BlockDurationMinutes = &request.BlockDurationMinutes
+	}
+	if !request.ValidUntil.IsZero() {
+		input.ValidUntil = &request.ValidUntil
+	}
+
+	result, err := client.RequestSpotInstances(input)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil || len(result.SpotInstanceRequests) != 1 {
+		return nil, &ErrUnexpectedResponse{}
+	}
+	return result.SpotInstanceRequests[0], nil
+}
+
+func cancelSpotRequestSync(client ec2iface.EC2API, spotRequestID string) error {
+	_, err := client.CancelSpotInstanceRequests(&ec2.CancelSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []*string{&spotRequestID},
+	})
+	return err
+}
+
+// blockUntilSpotRequestFulfilled polls the spot request until it becomes
+// active, or returns ErrSpotRequestFailed if it is closed, cancelled, or
+// fails for a reason that isn't going to resolve itself (e.g. the bid was
+// too low, or there was no capacity).
+//
+// price-too-low and capacity-not-available are reported by EC2 while the
+// request is still in the (non-terminal) "open" state, so those status
+// codes are checked directly rather than waiting for State to become
+// terminal.
+func (p *provisioner) blockUntilSpotRequestFulfilled(spotRequestID string) (*ec2.SpotInstanceRequest, error) {
+	var fulfilled *ec2.SpotInstanceRequest
+	err := WaitUntil(p.sleepFunction, 30, 10*time.Second, func() (bool, error) {
+		result, err := p.client.DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
+			SpotInstanceRequestIds: []*string{&spotRequestID},
+		})
+		if err != nil {
+			return false, err
+		}
+		if result == nil || len(result.SpotInstanceRequests) != 1 {
+			return false, &ErrUnexpectedResponse{}
+		}
+
+		req := result.SpotInstanceRequests[0]
+		statusCode := aws.StringValue(req.Status.Code)
+
+		switch statusCode {
+		case spotStatusPriceTooLow, spotStatusCapacityNotAvailable:
+			return false, &ErrSpotRequestFailed{StatusCode: statusCode, Message: aws.StringValue(req.Status.Message)}
+		}
+
+		switch aws.StringValue(req.State) {
+		case ec2.SpotInstanceStateActive:
+			fulfilled = req
+			return true, nil
+		case ec2.SpotInstanceStateFailed, ec2.SpotInstanceStateCancelled, ec2.SpotInstanceStateClosed:
+			return false, &ErrSpotRequestFailed{StatusCode: statusCode, Message: aws.StringValue(req.Status.Message)}
+		default:
+			return false, nil
+		}
+	})
+
+	if err != nil {
+		if spotErr, isSpotFailure := err.(*ErrSpotRequestFailed); isSpotFailure {
+			return nil, spotErr
+		}
+		// WaitUntil gives up after its retry budget is exhausted, which for a
+		// spot request we treat the same as any other unfulfillable request:
+		// a typed error callers can switch on to decide whether to fall back
+		// to on-demand.
+		return nil, &ErrSpotRequestFailed{StatusCode: "timeout", Message: err.Error()}
+	}
+	return fulfilled, nil
+}
+
+// createSpotInstance requests a spot instance, waits for it to be
+// fulfilled, and returns the resulting instance. If the request doesn't
+// reach the active state, the request is cancelled before returning the
+// error so it doesn't linger in the account.
+func (p *provisioner) createSpotInstance(
+	request CreateInstanceRequest, events chan<- api.CreateInstanceEvent) (*ec2.Instance, error) {
+
+	spotRequest, err := requestSpotInstanceSync(p.client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	fulfilled, err := p.blockUntilSpotRequestFulfilled(*spotRequest.SpotInstanceRequestId)
+	if err != nil {
+		cancelSpotRequestSync(p.client, *spotRequest.SpotInstanceRequestId)
+		return nil, err
+	}
+
+	events <- api.CreateInstanceEvent{
+		Type:  api.CreateInstanceSpotFulfilled,
+		Price: aws.StringValue(fulfilled.SpotPrice),
+	}
+
+	return getInstanceSync(p.client, *fulfilled.InstanceId)
+}
+
+// cancelPersistentSpotRequest cancels the spot request backing instanceID,
+// if any, but only when it's persistent -- a one-time request is already
+// done once its instance exists, and terminating the instance is enough.
+func cancelPersistentSpotRequest(client ec2iface.EC2API, instanceID string) error {
+	instance, err := getInstanceSync(client, instanceID)
+	if err != nil {
+		return err
+	}
+
+	if instance.SpotInstanceRequestId == nil {
+		return nil
+	}
+
+	result, err := client.DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []*string{instance.SpotInstanceRequestId},
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.SpotInstanceRequests) != 1 {
+		return nil
+	}
+
+	if aws.StringValue(result.SpotInstanceRequests[0].Type) != ec2.SpotInstanceTypePersistent {
+		return nil
+	}
+
+	return cancelSpotRequestSync(client, *instance.SpotInstanceRequestId)
+}
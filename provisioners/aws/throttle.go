@@ -0,0 +1,177 @@
+package aws
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+const (
+	// throttleDelayMin is the backoff delay a throttled client starts (and
+	// settles back down to) once it stops seeing RequestLimitExceeded.
+	throttleDelayMin = 1 * time.Second
+
+	// throttleDelayMax caps how long a single throttled call will sleep
+	// before retrying.
+	throttleDelayMax = 1 * time.Minute
+)
+
+// throttledEC2 wraps an ec2iface.EC2API so that calls which fail with an
+// EC2 rate-limit error are retried after an adaptive backoff rather than
+// bubbling the error up to the caller. The backoff delay is shared across
+// all goroutines using the client: it doubles on every consecutive
+// throttled call, up to throttleDelayMax, and decays back toward
+// throttleDelayMin as soon as a call stops being throttled.
+type throttledEC2 struct {
+	ec2iface.EC2API
+	sleepFunction func(time.Duration)
+	delayNanos    int64 // atomic; current backoff delay, in nanoseconds
+}
+
+// newThrottledClient returns client wrapped with adaptive throttle
+// handling for the EC2 calls infrakit makes.
+func newThrottledClient(client ec2iface.EC2API, sleepFunction func(time.Duration)) ec2iface.EC2API {
+	return &throttledEC2{
+		EC2API:        client,
+		sleepFunction: sleepFunction,
+		delayNanos:    int64(throttleDelayMin),
+	}
+}
+
+// CurrentDelay returns the throttle's current backoff delay. It exists
+// mainly so tests can assert the delay grew or shrank as expected.
+func (t *throttledEC2) CurrentDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.delayNanos))
+}
+
+// isThrottlingError returns true if err is an AWS error indicating the
+// request was rate-limited rather than rejected for some other reason.
+func isThrottlingError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "RequestLimitExceeded", "Throttling", "ThrottlingException":
+		return true
+	}
+
+	msg := strings.ToLower(awsErr.Message())
+	return strings.Contains(msg, "throttl") || strings.Contains(msg, "rate exceeded")
+}
+
+// call invokes fn, sleeping and retrying for as long as fn keeps failing
+// with a throttling error. The shared delay grows on every throttled
+// attempt and decays back toward throttleDelayMin as soon as fn succeeds
+// (or fails for some other reason).
+func (t *throttledEC2) call(fn func() error) error {
+	for {
+		err := fn()
+		if !isThrottlingError(err) {
+			t.decay()
+			return err
+		}
+		t.sleepFunction(t.grow())
+	}
+}
+
+// grow doubles the shared delay (capping at throttleDelayMax) and returns
+// the delay that was in effect before growing, which is what the caller
+// should actually sleep for.
+func (t *throttledEC2) grow() time.Duration {
+	for {
+		current := atomic.LoadInt64(&t.delayNanos)
+		next := current * 2
+		if next > int64(throttleDelayMax) {
+			next = int64(throttleDelayMax)
+		}
+		if atomic.CompareAndSwapInt64(&t.delayNanos, current, next) {
+			return time.Duration(current)
+		}
+	}
+}
+
+// decay halves the shared delay, never going below throttleDelayMin.
+func (t *throttledEC2) decay() {
+	for {
+		current := atomic.LoadInt64(&t.delayNanos)
+		if current <= int64(throttleDelayMin) {
+			return
+		}
+		next := current / 2
+		if next < int64(throttleDelayMin) {
+			next = int64(throttleDelayMin)
+		}
+		if atomic.CompareAndSwapInt64(&t.delayNanos, current, next) {
+			return
+		}
+	}
+}
+
+func (t *throttledEC2) RunInstances(input *ec2.RunInstancesInput) (output *ec2.Reservation, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.RunInstances(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) TerminateInstances(input *ec2.TerminateInstancesInput) (output *ec2.TerminateInstancesOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.TerminateInstances(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (output *ec2.DescribeInstancesOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.DescribeInstances(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) CreateTags(input *ec2.CreateTagsInput) (output *ec2.CreateTagsOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.CreateTags(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) RequestSpotInstances(input *ec2.RequestSpotInstancesInput) (output *ec2.RequestSpotInstancesOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.RequestSpotInstances(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) DescribeSpotInstanceRequests(input *ec2.DescribeSpotInstanceRequestsInput) (output *ec2.DescribeSpotInstanceRequestsOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.DescribeSpotInstanceRequests(input)
+		return callErr
+	})
+	return
+}
+
+func (t *throttledEC2) CancelSpotInstanceRequests(input *ec2.CancelSpotInstanceRequestsInput) (output *ec2.CancelSpotInstanceRequestsOutput, err error) {
+	err = t.call(func() error {
+		var callErr error
+		output, callErr = t.EC2API.CancelSpotInstanceRequests(input)
+		return callErr
+	})
+	return
+}
@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+type fakeEC2 struct {
+	ec2iface.EC2API
+	runInstances func(*ec2.RunInstancesInput) (*ec2.Reservation, error)
+}
+
+func (f *fakeEC2) RunInstances(input *ec2.RunInstancesInput) (*ec2.Reservation, error) {
+	return f.runInstances(input)
+}
+
+func TestThrottledClientRetriesAndGrowsDelayOnThrottling(t *testing.T) {
+	attempts := 0
+	fake := &fakeEC2{runInstances: func(*ec2.RunInstancesInput) (*ec2.Reservation, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+		}
+		return &ec2.Reservation{}, nil
+	}}
+
+	var slept []time.Duration
+	client := newThrottledClient(fake, func(d time.Duration) { slept = append(slept, d) })
+
+	if _, err := client.RunInstances(&ec2.RunInstancesInput{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts before success, got %d", attempts)
+	}
+
+	if len(slept) != 2 || slept[0] != throttleDelayMin || slept[1] != throttleDelayMin*2 {
+		t.Fatalf("expected sleeps [%s %s], got %v", throttleDelayMin, throttleDelayMin*2, slept)
+	}
+
+	// One success only decays the delay by one step, not back to the floor.
+	if delay := client.(*throttledEC2).CurrentDelay(); delay != throttleDelayMin*2 {
+		t.Fatalf("expected delay to have decayed to %s, got %s", throttleDelayMin*2, delay)
+	}
+}
+
+func TestThrottledClientDecaysTowardMinimumOnSuccess(t *testing.T) {
+	fake := &fakeEC2{runInstances: func(*ec2.RunInstancesInput) (*ec2.Reservation, error) {
+		return &ec2.Reservation{}, nil
+	}}
+
+	client := newThrottledClient(fake, func(time.Duration) {}).(*throttledEC2)
+	client.delayNanos = int64(throttleDelayMax)
+
+	if _, err := client.RunInstances(&ec2.RunInstancesInput{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if delay := client.CurrentDelay(); delay != throttleDelayMax/2 {
+		t.Fatalf("expected delay to halve after a success, got %s", delay)
+	}
+}
+
+func TestThrottledClientPassesThroughNonThrottlingErrors(t *testing.T) {
+	attempts := 0
+	fake := &fakeEC2{runInstances: func(*ec2.RunInstancesInput) (*ec2.Reservation, error) {
+		attempts++
+		return nil, awserr.New("InvalidAMIID.NotFound", "The AMI does not exist.", nil)
+	}}
+
+	client := newThrottledClient(fake, func(time.Duration) {
+		t.Fatal("should not sleep on a non-throttling error")
+	})
+
+	_, err := client.RunInstances(&ec2.RunInstancesInput{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Fatalf("expected exactly 1 attempt, got %d", attempts)
+	}
+}